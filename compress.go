@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	zstdMagic = []byte{0x28, 0xB5, 0x2F, 0xFD}
+	gzipMagic = []byte{0x1F, 0x8B}
+)
+
+// Decompressor turns a compressed record body into the raw protobuf bytes.
+// Implementations may be reused across records.
+type Decompressor interface {
+	// Name identifies the codec for diagnostic output.
+	Name() string
+	// Decompress returns the decompressed bytes for a single record body.
+	Decompress(data []byte) ([]byte, error)
+}
+
+// identityDecompressor passes the body through unchanged.
+type identityDecompressor struct{}
+
+func (identityDecompressor) Name() string { return "none" }
+
+func (identityDecompressor) Decompress(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// snappyDecompressor decodes snappy block format, falling back to the
+// streaming framed format used by some remote-write clients.
+type snappyDecompressor struct{}
+
+func (snappyDecompressor) Name() string { return "snappy" }
+
+func (snappyDecompressor) Decompress(data []byte) ([]byte, error) {
+	decoded, err := snappy.Decode(nil, data)
+	if err == nil {
+		return decoded, nil
+	}
+
+	streamed, streamErr := io.ReadAll(snappy.NewReader(bytes.NewReader(data)))
+	if streamErr != nil {
+		return nil, fmt.Errorf("snappy block decode error: %w (streaming fallback also failed: %v)", err, streamErr)
+	}
+	return streamed, nil
+}
+
+// gzipDecompressor decodes gzip-compressed bodies.
+type gzipDecompressor struct{}
+
+func (gzipDecompressor) Name() string { return "gzip" }
+
+func (gzipDecompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("gzip reader error: %w", err)
+	}
+	defer r.Close()
+
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("gzip decode error: %w", err)
+	}
+	return decoded, nil
+}
+
+// zstdDecompressor decodes zstd-compressed bodies. The underlying
+// *zstd.Decoder is expensive to allocate, so a single instance is reused
+// across records.
+type zstdDecompressor struct {
+	decoder *zstd.Decoder
+}
+
+func newZstdDecompressor() (*zstdDecompressor, error) {
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("zstd reader init error: %w", err)
+	}
+	return &zstdDecompressor{decoder: decoder}, nil
+}
+
+func (z *zstdDecompressor) Name() string { return "zstd" }
+
+func (z *zstdDecompressor) Decompress(data []byte) ([]byte, error) {
+	decoded, err := z.decoder.DecodeAll(data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("zstd decode error: %w", err)
+	}
+	return decoded, nil
+}
+
+// autoDecompressor sniffs the codec from the leading bytes of each record,
+// trying zstd and gzip magic numbers before falling back to snappy (block,
+// then streaming).
+type autoDecompressor struct {
+	zstd *zstdDecompressor
+}
+
+func newAutoDecompressor() (*autoDecompressor, error) {
+	z, err := newZstdDecompressor()
+	if err != nil {
+		return nil, err
+	}
+	return &autoDecompressor{zstd: z}, nil
+}
+
+func (a *autoDecompressor) Name() string { return "auto" }
+
+func (a *autoDecompressor) Decompress(data []byte) ([]byte, error) {
+	codec, decoded, err := a.decompressSniffed(data)
+	if err != nil {
+		return nil, err
+	}
+	_ = codec
+	return decoded, nil
+}
+
+// decompressSniffed decompresses data and also returns the codec name that
+// was used, so callers can surface it in per-record diagnostics.
+func (a *autoDecompressor) decompressSniffed(data []byte) (string, []byte, error) {
+	switch {
+	case bytes.HasPrefix(data, zstdMagic):
+		decoded, err := a.zstd.Decompress(data)
+		return "zstd", decoded, err
+	case bytes.HasPrefix(data, gzipMagic):
+		decoded, err := (gzipDecompressor{}).Decompress(data)
+		return "gzip", decoded, err
+	}
+
+	if decoded, err := snappy.Decode(nil, data); err == nil {
+		return "snappy", decoded, nil
+	}
+
+	decoded, err := io.ReadAll(snappy.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to detect compression codec (tried zstd magic, gzip magic, snappy block, snappy streaming): %w", err)
+	}
+	return "snappy-streaming", decoded, nil
+}
+
+// newDecompressor constructs the Decompressor named by the --compression flag.
+func newDecompressor(name string) (Decompressor, error) {
+	switch name {
+	case "", "auto":
+		return newAutoDecompressor()
+	case "snappy":
+		return snappyDecompressor{}, nil
+	case "zstd":
+		return newZstdDecompressor()
+	case "gzip":
+		return gzipDecompressor{}, nil
+	case "none", "identity":
+		return identityDecompressor{}, nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q (want auto, snappy, zstd, gzip, or none)", name)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EncodeOptions are output formatting options that every Encoder honors,
+// composing with whichever wire format it otherwise produces.
+type EncodeOptions struct {
+	Pretty    bool
+	HumanTime bool
+	// Codec is the compression codec the record was decoded with, surfaced
+	// in diagnostic headers where an encoder has a place for one.
+	Codec string
+}
+
+// Encoder renders a decoded WriteRequestJSON to an output stream. recordIndex
+// identifies the source record for diagnostic headers where an encoder uses them.
+type Encoder interface {
+	Encode(w io.Writer, recordIndex int, wreq *WriteRequestJSON, opts EncodeOptions) error
+}
+
+// StreamFinisher is implemented by encoders that need to write a trailer once
+// the entire input stream (every record, not just one) has been encoded.
+type StreamFinisher interface {
+	Finish(w io.Writer) error
+}
+
+// newEncoder constructs the Encoder named by the --format flag.
+func newEncoder(name string) (Encoder, error) {
+	switch name {
+	case "", "json":
+		return jsonEncoder{}, nil
+	case "jsonl":
+		return jsonlEncoder{}, nil
+	case "prom":
+		return promEncoder{}, nil
+	case "openmetrics":
+		return &openMetricsEncoder{emittedMeta: make(map[string]bool)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q (want json, jsonl, prom, or openmetrics)", name)
+	}
+}
+
+// timeSeriesWithHumanTime augments TimeSeries with a parallel array of
+// human-readable timestamps, used by the json/jsonl encoders instead of the
+// bolted-on comment lines the tool used to print for --human-time.
+type timeSeriesWithHumanTime struct {
+	TimeSeries
+	HumanTimestamps []string `json:"human_timestamps,omitempty"`
+}
+
+func withHumanTimes(ts TimeSeries) timeSeriesWithHumanTime {
+	humanTimes := make([]string, len(ts.Timestamps))
+	for i, t := range ts.Timestamps {
+		humanTimes[i] = humanReadableTime(t)
+	}
+	return timeSeriesWithHumanTime{TimeSeries: ts, HumanTimestamps: humanTimes}
+}
+
+// jsonEncoder reproduces the tool's original output: one pretty- or
+// compact-printed WriteRequestJSON per record, preceded by a "# Object N" header.
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(w io.Writer, recordIndex int, wreq *WriteRequestJSON, opts EncodeOptions) error {
+	var data []byte
+	var err error
+	if opts.HumanTime {
+		series := make([]timeSeriesWithHumanTime, len(wreq.Timeseries))
+		for i, ts := range wreq.Timeseries {
+			series[i] = withHumanTimes(ts)
+		}
+		data, err = marshalJSON(struct {
+			Timeseries []timeSeriesWithHumanTime `json:"timeseries"`
+		}{series}, opts.Pretty)
+	} else {
+		data, err = marshalJSON(wreq, opts.Pretty)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "# Object %d (compression: %s)\n", recordIndex, opts.Codec)
+	fmt.Fprintln(w, string(data))
+	return nil
+}
+
+// jsonlEncoder emits one TimeSeries per line with no sentinel lines, ideal
+// for jq/grep pipelines.
+type jsonlEncoder struct{}
+
+func (jsonlEncoder) Encode(w io.Writer, _ int, wreq *WriteRequestJSON, opts EncodeOptions) error {
+	for _, ts := range wreq.Timeseries {
+		var data []byte
+		var err error
+		if opts.HumanTime {
+			data, err = marshalJSON(withHumanTimes(ts), opts.Pretty)
+		} else {
+			data, err = marshalJSON(ts, opts.Pretty)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+	}
+	return nil
+}
+
+func marshalJSON(v interface{}, pretty bool) ([]byte, error) {
+	if pretty {
+		return jsonAPI.MarshalIndent(v, "", "  ")
+	}
+	return jsonAPI.Marshal(v)
+}
+
+// promEncoder renders samples as standard Prometheus text exposition lines:
+// metric_name{k="v",...} value timestamp_ms
+type promEncoder struct{}
+
+func (promEncoder) Encode(w io.Writer, _ int, wreq *WriteRequestJSON, opts EncodeOptions) error {
+	for _, ts := range wreq.Timeseries {
+		name, labelPairs := splitMetricName(ts.Labels)
+		labelStr := formatLabelPairs(labelPairs)
+		for i, v := range ts.Values {
+			sampleTs := ts.Timestamps[i]
+			if opts.HumanTime {
+				fmt.Fprintf(w, "# %s\n", humanReadableTime(sampleTs))
+			}
+			fmt.Fprintf(w, "%s%s %s %d\n", name, labelStr, formatPromFloat(v), sampleTs)
+		}
+	}
+	return nil
+}
+
+// openMetricsEncoder renders OpenMetrics 1.0 output, including HELP/TYPE/UNIT
+// lines when PRW 2.0 metadata is present and _created lines from CreatedTimestamp.
+// OpenMetrics is a single framed stream (it ends with one terminal "# EOF"
+// line and each metric's HELP/TYPE/UNIT may appear only once), so this
+// encoder tracks state across Encode calls and defers "# EOF" to Finish.
+type openMetricsEncoder struct {
+	emittedMeta map[string]bool
+}
+
+func (e *openMetricsEncoder) Encode(w io.Writer, _ int, wreq *WriteRequestJSON, opts EncodeOptions) error {
+	for _, ts := range wreq.Timeseries {
+		name, labelPairs := splitMetricName(ts.Labels)
+		labelStr := formatLabelPairs(labelPairs)
+
+		if ts.Metadata != nil && !e.emittedMeta[name] {
+			if ts.Metadata.Help != "" {
+				fmt.Fprintf(w, "# HELP %s %s\n", name, ts.Metadata.Help)
+			}
+			if ts.Metadata.Type != "" {
+				fmt.Fprintf(w, "# TYPE %s %s\n", name, openMetricsType(ts.Metadata.Type))
+			}
+			if ts.Metadata.Unit != "" {
+				fmt.Fprintf(w, "# UNIT %s %s\n", name, ts.Metadata.Unit)
+			}
+			e.emittedMeta[name] = true
+		}
+
+		if ts.CreatedTimestamp != 0 {
+			fmt.Fprintf(w, "%s_created%s %s\n", name, labelStr, formatPromFloat(float64(ts.CreatedTimestamp)/1000))
+		}
+
+		for i, v := range ts.Values {
+			sampleTs := ts.Timestamps[i]
+			fmt.Fprintf(w, "%s%s %s %s\n", name, labelStr, formatPromFloat(v), formatPromFloat(float64(sampleTs)/1000))
+		}
+	}
+	return nil
+}
+
+// Finish writes the OpenMetrics terminal marker once the whole input stream
+// has been encoded, per the format's one-EOF-per-stream framing rule.
+func (e *openMetricsEncoder) Finish(w io.Writer) error {
+	_, err := fmt.Fprintln(w, "# EOF")
+	return err
+}
+
+// openMetricsType maps our free-form metadata Type string (a
+// writev2.Metadata_MetricType name like "METRIC_TYPE_COUNTER") to the
+// lowercase type keyword OpenMetrics expects.
+func openMetricsType(t string) string {
+	t = strings.TrimPrefix(t, "METRIC_TYPE_")
+	return strings.ToLower(t)
+}
+
+// splitMetricName pulls __name__ out of a label set, returning it alongside
+// the remaining labels sorted by key for deterministic output.
+func splitMetricName(labels map[string]string) (string, []labelPair) {
+	name := labels["__name__"]
+	pairs := make([]labelPair, 0, len(labels))
+	for k, v := range labels {
+		if k == "__name__" {
+			continue
+		}
+		pairs = append(pairs, labelPair{k, v})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].name < pairs[j].name })
+	return name, pairs
+}
+
+type labelPair struct {
+	name  string
+	value string
+}
+
+func formatLabelPairs(pairs []labelPair) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, p := range pairs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(p.name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(p.value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeLabelValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return v
+}
+
+// formatPromFloat renders a float64 the way the Prometheus text/OpenMetrics
+// exposition formats expect: NaN/+Inf/-Inf as bare (unquoted) tokens.
+func formatPromFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
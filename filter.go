@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// matcherGroup is one parsed --match/--drop selector: a set of label
+// matchers that must ALL match for the selector itself to match a series,
+// exactly like a PromQL vector selector.
+type matcherGroup []*labels.Matcher
+
+func (g matcherGroup) matches(labelSet map[string]string) bool {
+	for _, m := range g {
+		if !m.Matches(labelSet[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matcherGroupList implements flag.Value so --match/--drop can be repeated,
+// each occurrence parsed with PromQL's own matcher parser so =, !=, =~, !~
+// behave identically to Prometheus itself.
+type matcherGroupList struct {
+	groups []matcherGroup
+}
+
+func (l *matcherGroupList) String() string {
+	if l == nil || len(l.groups) == 0 {
+		return ""
+	}
+	parts := make([]string, len(l.groups))
+	for i, g := range l.groups {
+		parts[i] = fmt.Sprint(g)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (l *matcherGroupList) Set(value string) error {
+	matchers, err := parser.ParseMetricSelector(value)
+	if err != nil {
+		return fmt.Errorf("invalid label matcher %q: %w", value, err)
+	}
+	l.groups = append(l.groups, matcherGroup(matchers))
+	return nil
+}
+
+// SeriesFilter applies --match/--drop/--since/--until/--limit to decoded
+// time series before they're encoded.
+type SeriesFilter struct {
+	Match []matcherGroup
+	Drop  []matcherGroup
+	Since int64 // milliseconds since epoch; 0 is unbounded
+	Until int64 // milliseconds since epoch; 0 is unbounded
+	Limit int   // 0 is unlimited
+
+	kept int
+}
+
+// Active reports whether any filtering was requested, so callers can skip
+// building a SeriesFilter-aware path entirely when nothing was configured.
+func (f *SeriesFilter) Active() bool {
+	return f != nil && (len(f.Match) > 0 || len(f.Drop) > 0 || f.Since != 0 || f.Until != 0 || f.Limit > 0)
+}
+
+// Done reports whether --limit has already been reached, so the caller can
+// stop reading further input entirely.
+func (f *SeriesFilter) Done() bool {
+	return f.Limit > 0 && f.kept >= f.Limit
+}
+
+func (f *SeriesFilter) keep(labelSet map[string]string) bool {
+	if f.Done() {
+		return false
+	}
+	if len(f.Match) > 0 {
+		matchedAny := false
+		for _, g := range f.Match {
+			if g.matches(labelSet) {
+				matchedAny = true
+				break
+			}
+		}
+		if !matchedAny {
+			return false
+		}
+	}
+	for _, g := range f.Drop {
+		if g.matches(labelSet) {
+			return false
+		}
+	}
+	return true
+}
+
+// inWindow reports whether t falls within the [Since, Until] timestamp range.
+func (f *SeriesFilter) inWindow(t int64) bool {
+	if f.Since != 0 && t < f.Since {
+		return false
+	}
+	if f.Until != 0 && t > f.Until {
+		return false
+	}
+	return true
+}
+
+// window restricts ts's samples, exemplars, and histograms to the
+// [Since, Until] timestamp range; each carries its own timestamp and must be
+// windowed independently.
+func (f *SeriesFilter) window(ts *TimeSeries) {
+	if f.Since == 0 && f.Until == 0 {
+		return
+	}
+
+	timestamps := ts.Timestamps[:0:0]
+	values := ts.Values[:0:0]
+	for i, t := range ts.Timestamps {
+		if !f.inWindow(t) {
+			continue
+		}
+		timestamps = append(timestamps, t)
+		values = append(values, ts.Values[i])
+	}
+	ts.Timestamps = timestamps
+	ts.Values = values
+
+	exemplars := ts.Exemplars[:0:0]
+	for _, ex := range ts.Exemplars {
+		if f.inWindow(ex.Timestamp) {
+			exemplars = append(exemplars, ex)
+		}
+	}
+	ts.Exemplars = exemplars
+
+	histograms := ts.Histograms[:0:0]
+	for _, h := range ts.Histograms {
+		if f.inWindow(h.Timestamp) {
+			histograms = append(histograms, h)
+		}
+	}
+	ts.Histograms = histograms
+}
+
+// Apply filters wreq.Timeseries in place: dropping series that don't pass
+// the matchers or that arrive after --limit is reached, and trimming
+// remaining series down to the --since/--until window. A series the window
+// emptied out entirely is dropped too (and doesn't count toward --limit);
+// that check only runs when windowing is actually in effect, so a
+// sample-less series (e.g. PRW 2.0 metadata-only) survives a no-flag
+// invocation exactly as it did before filtering existed.
+func (f *SeriesFilter) Apply(wreq *WriteRequestJSON) {
+	windowing := f.Since != 0 || f.Until != 0
+	kept := wreq.Timeseries[:0]
+	for _, ts := range wreq.Timeseries {
+		if f.Done() {
+			break
+		}
+		if !f.keep(ts.Labels) {
+			continue
+		}
+		f.window(&ts)
+		if windowing && len(ts.Values) == 0 && len(ts.Histograms) == 0 && len(ts.Exemplars) == 0 {
+			continue
+		}
+		f.kept++
+		kept = append(kept, ts)
+	}
+	wreq.Timeseries = kept
+}
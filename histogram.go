@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// HistogramDecodeMode controls how native histogram buckets are rendered.
+type HistogramDecodeMode int
+
+const (
+	// HistogramDecodeRaw emits the wire encoding as-is: span offsets/lengths
+	// plus delta- (integer) or absolute- (float) encoded bucket counts.
+	HistogramDecodeRaw HistogramDecodeMode = iota
+	// HistogramDecodeCumulative additionally reconstructs the absolute count
+	// of each populated bucket from the delta encoding.
+	HistogramDecodeCumulative
+)
+
+// parseHistogramDecodeMode parses the --decode-histograms flag value.
+func parseHistogramDecodeMode(s string) (HistogramDecodeMode, error) {
+	switch s {
+	case "", "raw":
+		return HistogramDecodeRaw, nil
+	case "cumulative":
+		return HistogramDecodeCumulative, nil
+	default:
+		return HistogramDecodeRaw, fmt.Errorf("unknown --decode-histograms mode %q (want raw or cumulative)", s)
+	}
+}
+
+// applyHistogramDecodeMode reconstructs absolute per-bucket counts from the
+// delta encoding when mode is cumulative; it is a no-op in raw mode or for
+// float histograms, which already carry absolute counts.
+func applyHistogramDecodeMode(h *Histogram, mode HistogramDecodeMode) {
+	if mode != HistogramDecodeCumulative || h.IsFloat {
+		return
+	}
+	h.PositiveBucketCounts = reconstructCumulativeBuckets(h.PositiveSpans, h.PositiveDeltas)
+	h.NegativeBucketCounts = reconstructCumulativeBuckets(h.NegativeSpans, h.NegativeDeltas)
+}
+
+// reconstructCumulativeBuckets expands span+delta encoded bucket counts into
+// one absolute count per populated bucket, in bucket index order. Spans mark
+// runs of populated buckets separated by gaps (Offset); gaps contribute no
+// entries, matching the native histogram wire format.
+func reconstructCumulativeBuckets(spans []Span, deltas []int64) []float64 {
+	if len(spans) == 0 {
+		return nil
+	}
+	counts := make([]float64, 0, len(deltas))
+	var current int64
+	idx := 0
+	for _, span := range spans {
+		for i := uint32(0); i < span.Length; i++ {
+			if idx < len(deltas) {
+				current += deltas[idx]
+				idx++
+			}
+			counts = append(counts, float64(current))
+		}
+	}
+	return counts
+}
+
+// convertPrompbHistogram converts a prompb.Histogram (Remote Write 1.0) into
+// the shared readable Histogram representation, mirroring convertWriteV2Histogram.
+func convertPrompbHistogram(h prompb.Histogram) Histogram {
+	_, isFloat := h.GetCount().(*prompb.Histogram_CountFloat)
+
+	out := Histogram{
+		IsFloat:          isFloat,
+		Schema:           h.Schema,
+		ZeroThreshold:    h.ZeroThreshold,
+		CounterResetHint: h.ResetHint.String(),
+		Timestamp:        h.Timestamp,
+	}
+
+	if isFloat {
+		out.Count = h.GetCountFloat()
+		out.ZeroCount = h.GetZeroCountFloat()
+	} else {
+		out.Count = float64(h.GetCountInt())
+		out.ZeroCount = float64(h.GetZeroCountInt())
+	}
+	out.Sum = h.Sum
+
+	out.PositiveSpans = convertPrompbSpans(h.PositiveSpans)
+	out.NegativeSpans = convertPrompbSpans(h.NegativeSpans)
+	out.PositiveDeltas = h.PositiveDeltas
+	out.NegativeDeltas = h.NegativeDeltas
+	out.PositiveCounts = h.PositiveCounts
+	out.NegativeCounts = h.NegativeCounts
+
+	return out
+}
+
+func convertPrompbSpans(spans []prompb.BucketSpan) []Span {
+	if len(spans) == 0 {
+		return nil
+	}
+	out := make([]Span, len(spans))
+	for i, s := range spans {
+		out[i] = Span{Offset: s.Offset, Length: s.Length}
+	}
+	return out
+}
+
+// convertPrompbExemplar converts a prompb.Exemplar (Remote Write 1.0) into
+// the shared readable Exemplar representation.
+func convertPrompbExemplar(e prompb.Exemplar) Exemplar {
+	labels := make(map[string]string, len(e.Labels))
+	for _, l := range e.Labels {
+		labels[l.Name] = l.Value
+	}
+	return Exemplar{
+		Labels:    labels,
+		Value:     e.Value,
+		Timestamp: e.Timestamp,
+	}
+}
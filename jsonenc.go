@@ -0,0 +1,326 @@
+package main
+
+import (
+	"math"
+	"unsafe"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// jsonAPI replaces encoding/json for all marshaling/unmarshaling in this
+// tool. It is configured to behave like encoding/json (same field tags,
+// same map ordering rules) but avoids its reflection overhead, and lets us
+// register direct, unsafe-pointer-based encoders for the prompb types on
+// the hot path below, the same approach Prometheus itself uses in
+// web/api/v1/json_codec.go.
+var jsonAPI = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// jsonAPIPretty is jsonAPI with two-space indention baked into the stream
+// config, so marshalWriteRequestFast can pretty-print without falling back
+// to the slower MarshalIndent reflection path.
+var jsonAPIPretty = jsoniter.Config{
+	EscapeHTML:             true,
+	SortMapKeys:            true,
+	ValidateJsonRawMessage: true,
+	IndentionStep:          2,
+}.Froze()
+
+func init() {
+	jsoniter.RegisterTypeEncoder("[]prompb.Label", labelsEncoder{})
+	jsoniter.RegisterTypeEncoder("prompb.Sample", sampleEncoder{})
+	jsoniter.RegisterTypeEncoder("[]prompb.Exemplar", exemplarsEncoder{})
+	jsoniter.RegisterTypeEncoder("[]prompb.Histogram", histogramsEncoder{})
+}
+
+// writeJSONFloat writes a float64 the way Prometheus' own JSON codec does:
+// NaN/+Inf/-Inf are written as quoted strings, since they aren't valid JSON
+// numbers and encoding/json would otherwise refuse to marshal them at all.
+func writeJSONFloat(stream *jsoniter.Stream, v float64) {
+	switch {
+	case math.IsNaN(v):
+		stream.WriteString("NaN")
+	case math.IsInf(v, 1):
+		stream.WriteString("+Inf")
+	case math.IsInf(v, -1):
+		stream.WriteString("-Inf")
+	default:
+		stream.WriteFloat64(v)
+	}
+}
+
+// labelsEncoder writes a []prompb.Label directly as a {"name":"value"} JSON
+// object, the same shape convertToReadableJSON builds by hand with a Go
+// map, but without allocating that map.
+type labelsEncoder struct{}
+
+func (labelsEncoder) IsEmpty(ptr unsafe.Pointer) bool {
+	return len(*(*[]prompb.Label)(ptr)) == 0
+}
+
+func (labelsEncoder) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
+	labels := *(*[]prompb.Label)(ptr)
+	stream.WriteObjectStart()
+	for i, l := range labels {
+		if i > 0 {
+			stream.WriteMore()
+		}
+		stream.WriteObjectField(l.Name)
+		stream.WriteString(l.Value)
+	}
+	stream.WriteObjectEnd()
+}
+
+// sampleEncoder writes a prompb.Sample as {"value":V,"timestamp":T}.
+type sampleEncoder struct{}
+
+func (sampleEncoder) IsEmpty(unsafe.Pointer) bool { return false }
+
+func (sampleEncoder) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
+	s := (*prompb.Sample)(ptr)
+	stream.WriteObjectStart()
+	stream.WriteObjectField("value")
+	writeJSONFloat(stream, s.Value)
+	stream.WriteMore()
+	stream.WriteObjectField("timestamp")
+	stream.WriteInt64(s.Timestamp)
+	stream.WriteObjectEnd()
+}
+
+// exemplarsEncoder writes a []prompb.Exemplar directly, reusing labelsEncoder
+// for each exemplar's label set.
+type exemplarsEncoder struct{}
+
+func (exemplarsEncoder) IsEmpty(ptr unsafe.Pointer) bool {
+	return len(*(*[]prompb.Exemplar)(ptr)) == 0
+}
+
+func (exemplarsEncoder) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
+	exemplars := *(*[]prompb.Exemplar)(ptr)
+	stream.WriteArrayStart()
+	for i, ex := range exemplars {
+		if i > 0 {
+			stream.WriteMore()
+		}
+		stream.WriteObjectStart()
+		stream.WriteObjectField("labels")
+		labelsEncoder{}.Encode(unsafe.Pointer(&ex.Labels), stream)
+		stream.WriteMore()
+		stream.WriteObjectField("value")
+		writeJSONFloat(stream, ex.Value)
+		stream.WriteMore()
+		stream.WriteObjectField("timestamp")
+		stream.WriteInt64(ex.Timestamp)
+		stream.WriteObjectEnd()
+	}
+	stream.WriteArrayEnd()
+}
+
+// histogramsEncoder writes a []prompb.Histogram directly from the protobuf
+// oneof fields, preserving full uint64 bucket-count precision that would be
+// lost converting through float64 along the way.
+type histogramsEncoder struct{}
+
+func (histogramsEncoder) IsEmpty(ptr unsafe.Pointer) bool {
+	return len(*(*[]prompb.Histogram)(ptr)) == 0
+}
+
+func (histogramsEncoder) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
+	histograms := *(*[]prompb.Histogram)(ptr)
+	stream.WriteArrayStart()
+	for i := range histograms {
+		if i > 0 {
+			stream.WriteMore()
+		}
+		writeHistogram(stream, &histograms[i])
+	}
+	stream.WriteArrayEnd()
+}
+
+func writeHistogram(stream *jsoniter.Stream, h *prompb.Histogram) {
+	_, isFloat := h.GetCount().(*prompb.Histogram_CountFloat)
+
+	stream.WriteObjectStart()
+	stream.WriteObjectField("is_float")
+	stream.WriteBool(isFloat)
+	stream.WriteMore()
+
+	stream.WriteObjectField("count")
+	if isFloat {
+		writeJSONFloat(stream, h.GetCountFloat())
+	} else {
+		stream.WriteUint64(h.GetCountInt())
+	}
+	stream.WriteMore()
+
+	stream.WriteObjectField("sum")
+	writeJSONFloat(stream, h.Sum)
+	stream.WriteMore()
+
+	stream.WriteObjectField("schema")
+	stream.WriteInt32(h.Schema)
+	stream.WriteMore()
+
+	stream.WriteObjectField("zero_threshold")
+	writeJSONFloat(stream, h.ZeroThreshold)
+	stream.WriteMore()
+
+	stream.WriteObjectField("zero_count")
+	if isFloat {
+		writeJSONFloat(stream, h.GetZeroCountFloat())
+	} else {
+		stream.WriteUint64(h.GetZeroCountInt())
+	}
+
+	// These mirror the Histogram struct's omitempty span/delta/count fields
+	// (see protocol.go), so the fast path's JSON shape doesn't depend on
+	// which code path a given --protocol-version happens to take.
+	if len(h.PositiveSpans) > 0 {
+		stream.WriteMore()
+		stream.WriteObjectField("positive_spans")
+		writeBucketSpans(stream, h.PositiveSpans)
+	}
+	if len(h.PositiveDeltas) > 0 {
+		stream.WriteMore()
+		stream.WriteObjectField("positive_deltas")
+		writeInt64Array(stream, h.PositiveDeltas)
+	}
+	if len(h.PositiveCounts) > 0 {
+		stream.WriteMore()
+		stream.WriteObjectField("positive_counts")
+		writeFloat64Array(stream, h.PositiveCounts)
+	}
+	if len(h.NegativeSpans) > 0 {
+		stream.WriteMore()
+		stream.WriteObjectField("negative_spans")
+		writeBucketSpans(stream, h.NegativeSpans)
+	}
+	if len(h.NegativeDeltas) > 0 {
+		stream.WriteMore()
+		stream.WriteObjectField("negative_deltas")
+		writeInt64Array(stream, h.NegativeDeltas)
+	}
+	if len(h.NegativeCounts) > 0 {
+		stream.WriteMore()
+		stream.WriteObjectField("negative_counts")
+		writeFloat64Array(stream, h.NegativeCounts)
+	}
+
+	stream.WriteMore()
+	stream.WriteObjectField("counter_reset_hint")
+	stream.WriteString(h.ResetHint.String())
+
+	stream.WriteMore()
+	stream.WriteObjectField("timestamp")
+	stream.WriteInt64(h.Timestamp)
+	stream.WriteObjectEnd()
+}
+
+func writeBucketSpans(stream *jsoniter.Stream, spans []prompb.BucketSpan) {
+	stream.WriteArrayStart()
+	for i, s := range spans {
+		if i > 0 {
+			stream.WriteMore()
+		}
+		stream.WriteObjectStart()
+		stream.WriteObjectField("offset")
+		stream.WriteInt32(s.Offset)
+		stream.WriteMore()
+		stream.WriteObjectField("length")
+		stream.WriteUint32(s.Length)
+		stream.WriteObjectEnd()
+	}
+	stream.WriteArrayEnd()
+}
+
+func writeInt64Array(stream *jsoniter.Stream, vals []int64) {
+	stream.WriteArrayStart()
+	for i, v := range vals {
+		if i > 0 {
+			stream.WriteMore()
+		}
+		stream.WriteInt64(v)
+	}
+	stream.WriteArrayEnd()
+}
+
+func writeFloat64Array(stream *jsoniter.Stream, vals []float64) {
+	stream.WriteArrayStart()
+	for i, v := range vals {
+		if i > 0 {
+			stream.WriteMore()
+		}
+		writeJSONFloat(stream, v)
+	}
+	stream.WriteArrayEnd()
+}
+
+// marshalWriteRequestFast encodes a prompb.WriteRequest straight to JSON in
+// the WriteRequestJSON shape, reading labels and samples directly off the
+// protobuf struct instead of building a TimeSeries/map[string]string for
+// every series first. pretty selects the same two-space indention as the
+// struct-based path, via a stream config rather than a slower MarshalIndent pass.
+func marshalWriteRequestFast(wreq *prompb.WriteRequest, pretty bool) ([]byte, error) {
+	api := jsonAPI
+	if pretty {
+		api = jsonAPIPretty
+	}
+	stream := api.BorrowStream(nil)
+	defer api.ReturnStream(stream)
+
+	stream.WriteObjectStart()
+	stream.WriteObjectField("timeseries")
+	stream.WriteArrayStart()
+	for i, ts := range wreq.Timeseries {
+		if i > 0 {
+			stream.WriteMore()
+		}
+		stream.WriteObjectStart()
+
+		stream.WriteObjectField("labels")
+		stream.WriteVal(ts.Labels)
+		stream.WriteMore()
+
+		stream.WriteObjectField("timestamps")
+		stream.WriteArrayStart()
+		for j, s := range ts.Samples {
+			if j > 0 {
+				stream.WriteMore()
+			}
+			stream.WriteInt64(s.Timestamp)
+		}
+		stream.WriteArrayEnd()
+		stream.WriteMore()
+
+		stream.WriteObjectField("values")
+		stream.WriteArrayStart()
+		for j, s := range ts.Samples {
+			if j > 0 {
+				stream.WriteMore()
+			}
+			writeJSONFloat(stream, s.Value)
+		}
+		stream.WriteArrayEnd()
+
+		if len(ts.Exemplars) > 0 {
+			stream.WriteMore()
+			stream.WriteObjectField("exemplars")
+			stream.WriteVal(ts.Exemplars)
+		}
+
+		if len(ts.Histograms) > 0 {
+			stream.WriteMore()
+			stream.WriteObjectField("histograms")
+			stream.WriteVal(ts.Histograms)
+		}
+
+		stream.WriteObjectEnd()
+	}
+	stream.WriteArrayEnd()
+	stream.WriteObjectEnd()
+
+	if stream.Error != nil {
+		return nil, stream.Error
+	}
+	return append([]byte(nil), stream.Buffer()...), nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// genBenchWriteRequest builds a synthetic prompb.WriteRequest large enough
+// (multi-MB once marshaled) to make the allocation difference between the
+// struct-based and fast marshal paths measurable.
+func genBenchWriteRequest(numSeries, numSamples int) *prompb.WriteRequest {
+	wreq := &prompb.WriteRequest{
+		Timeseries: make([]prompb.TimeSeries, numSeries),
+	}
+	for i := range wreq.Timeseries {
+		labels := []prompb.Label{
+			{Name: "__name__", Value: "bench_metric"},
+			{Name: "instance", Value: "host-0001:9090"},
+			{Name: "job", Value: "bench"},
+		}
+		samples := make([]prompb.Sample, numSamples)
+		for j := range samples {
+			samples[j] = prompb.Sample{Value: float64(j), Timestamp: int64(1700000000000 + j*1000)}
+		}
+		wreq.Timeseries[i] = prompb.TimeSeries{Labels: labels, Samples: samples}
+	}
+	return wreq
+}
+
+// BenchmarkMarshalStructPath measures the original path: convert the
+// protobuf into the TimeSeries/map[string]string struct, then marshal that.
+func BenchmarkMarshalStructPath(b *testing.B) {
+	wreq := genBenchWriteRequest(1000, 500)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		jsonStruct := convertToReadableJSON(wreq, HistogramDecodeRaw)
+		if _, err := marshalJSON(jsonStruct, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMarshalFastPath measures marshalWriteRequestFast, which reads
+// labels and samples directly off the protobuf struct.
+func BenchmarkMarshalFastPath(b *testing.B) {
+	wreq := genBenchWriteRequest(1000, 500)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := marshalWriteRequestFast(wreq, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
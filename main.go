@@ -1,15 +1,13 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"time"
 
-	"github.com/gogo/protobuf/proto"
-	"github.com/golang/snappy"
+	jsoniter "github.com/json-iterator/go"
 	"github.com/prometheus/prometheus/prompb"
 )
 
@@ -20,9 +18,13 @@ type PrometheusRecord struct {
 
 // TimeSeries represents a decoded Prometheus time series in a more readable format
 type TimeSeries struct {
-	Labels     map[string]string `json:"labels"`
-	Timestamps []int64           `json:"timestamps"`
-	Values     []float64         `json:"values"`
+	Labels           map[string]string `json:"labels"`
+	Timestamps       []int64           `json:"timestamps"`
+	Values           []float64         `json:"values"`
+	Exemplars        []Exemplar        `json:"exemplars,omitempty"`
+	Histograms       []Histogram       `json:"histograms,omitempty"`
+	Metadata         *Metadata         `json:"metadata,omitempty"`
+	CreatedTimestamp int64             `json:"created_timestamp,omitempty"`
 }
 
 // WriteRequestJSON is a more readable representation of prompb.WriteRequest
@@ -30,25 +32,8 @@ type WriteRequestJSON struct {
 	Timeseries []TimeSeries `json:"timeseries"`
 }
 
-// decodePrompbWriteReq decodes the wrapped prompb.WriteRequest
-func decodePrompbWriteReq(record *PrometheusRecord) (*prompb.WriteRequest, error) {
-	// Decompress the snappy-compressed data
-	data, err := snappy.Decode(nil, record.Body)
-	if err != nil {
-		return nil, fmt.Errorf("snappy decode error: %w", err)
-	}
-
-	// Unmarshal the protobuf message
-	var req prompb.WriteRequest
-	if err := proto.Unmarshal(data, &req); err != nil {
-		return nil, fmt.Errorf("protobuf unmarshal error: %w", err)
-	}
-
-	return &req, nil
-}
-
 // convertToReadableJSON converts a prompb.WriteRequest to a more readable JSON structure
-func convertToReadableJSON(wreq *prompb.WriteRequest) *WriteRequestJSON {
+func convertToReadableJSON(wreq *prompb.WriteRequest, mode HistogramDecodeMode) *WriteRequestJSON {
 	result := &WriteRequestJSON{
 		Timeseries: make([]TimeSeries, len(wreq.Timeseries)),
 	}
@@ -68,10 +53,23 @@ func convertToReadableJSON(wreq *prompb.WriteRequest) *WriteRequestJSON {
 			values[j] = sample.Value
 		}
 
+		exemplars := make([]Exemplar, len(ts.Exemplars))
+		for j, ex := range ts.Exemplars {
+			exemplars[j] = convertPrompbExemplar(ex)
+		}
+
+		histograms := make([]Histogram, len(ts.Histograms))
+		for j, h := range ts.Histograms {
+			histograms[j] = convertPrompbHistogram(h)
+			applyHistogramDecodeMode(&histograms[j], mode)
+		}
+
 		result.Timeseries[i] = TimeSeries{
 			Labels:     labels,
 			Timestamps: timestamps,
 			Values:     values,
+			Exemplars:  exemplars,
+			Histograms: histograms,
 		}
 	}
 
@@ -86,12 +84,12 @@ func humanReadableTime(timestamp int64) string {
 
 // streamingJSONDecoder reads and processes a stream of JSON objects without requiring them to be newline-delimited
 type streamingJSONDecoder struct {
-	decoder *json.Decoder
+	decoder *jsoniter.Decoder
 	count   int
 }
 
 func newStreamingJSONDecoder(r io.Reader) *streamingJSONDecoder {
-	decoder := json.NewDecoder(r)
+	decoder := jsonAPI.NewDecoder(r)
 	// Configure the decoder to support streams of concatenated JSON objects
 	decoder.UseNumber()
 	return &streamingJSONDecoder{
@@ -110,22 +108,69 @@ func (s *streamingJSONDecoder) next() (*PrometheusRecord, error) {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+
 	inputFile := flag.String("input", "", "Input file containing PrometheusRecord entries (one per line)")
 	outputFile := flag.String("output", "", "Output file for JSON results (default: stdout)")
 	prettyPrint := flag.Bool("pretty", true, "Enable pretty-printing of JSON output")
 	humanTime := flag.Bool("human-time", false, "Show human-readable timestamps in output")
+	protocolVersionFlag := flag.String("protocol-version", "auto", "Remote Write protocol version to decode: auto, v1, or v2")
+	compressionFlag := flag.String("compression", "auto", "Compression codec to decode: auto, snappy, zstd, gzip, or none")
+	decodeHistogramsFlag := flag.String("decode-histograms", "raw", "Native histogram bucket rendering: raw or cumulative")
+	formatFlag := flag.String("format", "json", "Output format: json, jsonl, prom, or openmetrics")
+	var matchList, dropList matcherGroupList
+	flag.Var(&matchList, "match", `PromQL label matcher selecting series to keep, e.g. '{job="foo",instance=~"web.*"}' (repeatable, OR'd together)`)
+	flag.Var(&dropList, "drop", `PromQL label matcher selecting series to exclude, e.g. '{__name__="up"}' (repeatable)`)
+	sinceFlag := flag.Int64("since", 0, "Drop samples before this timestamp (milliseconds since epoch)")
+	untilFlag := flag.Int64("until", 0, "Drop samples after this timestamp (milliseconds since epoch)")
+	limitFlag := flag.Int("limit", 0, "Stop after this many series have been kept (0 is unlimited)")
 	flag.Parse()
 
 	if *inputFile == "" {
-		fmt.Println("Error: Input file is required")
+		fmt.Fprintln(os.Stderr, "Error: Input file is required")
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	protocolVersion, err := parseProtocolVersion(*protocolVersionFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	decomp, err := newDecompressor(*compressionFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	histogramMode, err := parseHistogramDecodeMode(*decodeHistogramsFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	encoder, err := newEncoder(*formatFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	filter := &SeriesFilter{
+		Match: matchList.groups,
+		Drop:  dropList.groups,
+		Since: *sinceFlag,
+		Until: *untilFlag,
+		Limit: *limitFlag,
+	}
+
 	// Open input file
 	file, err := os.Open(*inputFile)
 	if err != nil {
-		fmt.Printf("Error opening input file: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error opening input file: %v\n", err)
 		os.Exit(1)
 	}
 	defer file.Close()
@@ -137,7 +182,7 @@ func main() {
 	} else {
 		output, err = os.Create(*outputFile)
 		if err != nil {
-			fmt.Printf("Error creating output file: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
 			os.Exit(1)
 		}
 		defer output.Close()
@@ -153,53 +198,56 @@ func main() {
 			break
 		}
 		if err != nil {
-			fmt.Printf("Error parsing JSON object #%d: %v\n", decoder.count, err)
+			fmt.Fprintf(os.Stderr, "Error parsing JSON object #%d: %v\n", decoder.count, err)
 			continue
 		}
 
-		// Decode the PrometheusRecord
-		wreq, err := decodePrompbWriteReq(record)
-		if err != nil {
-			fmt.Printf("Error decoding JSON object #%d: %v\n", decoder.count, err)
+		// The hot path: plain JSON v1 output with no further processing can be
+		// marshaled straight from the protobuf, skipping the
+		// TimeSeries/map[string]string conversion entirely. This covers the
+		// default invocation too: --pretty defaults to true, and
+		// marshalWriteRequestFast indents just as well as the struct path.
+		if _, isJSON := encoder.(jsonEncoder); isJSON && protocolVersion == ProtocolVersionV1 && !*humanTime && histogramMode == HistogramDecodeRaw && !filter.Active() {
+			wreq, codec, err := decodeRawV1(record, decomp)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error decoding JSON object #%d: %v\n", decoder.count, err)
+				continue
+			}
+			jsonData, err := marshalWriteRequestFast(wreq, *prettyPrint)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error encoding JSON object #%d to JSON: %v\n", decoder.count, err)
+				continue
+			}
+			fmt.Fprintf(output, "# Object %d (compression: %s)\n", decoder.count, codec)
+			fmt.Fprintln(output, string(jsonData))
 			continue
 		}
 
-		// Convert to our more readable format
-		jsonStruct := convertToReadableJSON(wreq)
-
-		// Apply human-readable time conversion if requested
-		if *humanTime {
-			for i := range jsonStruct.Timeseries {
-				humanTimes := make([]string, len(jsonStruct.Timeseries[i].Timestamps))
-				for j, ts := range jsonStruct.Timeseries[i].Timestamps {
-					humanTimes[j] = humanReadableTime(ts)
-				}
-				// We need to output this differently, so create a custom marshaling
-				// This would require a custom struct and marshaling approach
-				// For simplicity, we'll just add a note about it
-				fmt.Fprintf(output, "# Object %d: Human-readable timestamps for reference:\n", decoder.count)
-				for j, humanTime := range humanTimes {
-					fmt.Fprintf(output, "#   Sample %d: %s\n", j, humanTime)
-				}
-			}
+		// Decode the PrometheusRecord, autodetecting v1 vs v2 and the compression codec unless pinned by flag
+		jsonStruct, codec, err := decodeWriteRequest(record, protocolVersion, decomp, histogramMode)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error decoding JSON object #%d: %v\n", decoder.count, err)
+			continue
 		}
 
-		// Output the JSON
-		var jsonData []byte
-		if *prettyPrint {
-			jsonData, err = json.MarshalIndent(jsonStruct, "", "  ")
-		} else {
-			jsonData, err = json.Marshal(jsonStruct)
-		}
+		filter.Apply(jsonStruct)
 
-		if err != nil {
-			fmt.Printf("Error encoding JSON object #%d to JSON: %v\n", decoder.count, err)
+		opts := EncodeOptions{Pretty: *prettyPrint, HumanTime: *humanTime, Codec: codec}
+		if err := encoder.Encode(output, decoder.count, jsonStruct, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON object #%d: %v (compression: %s)\n", decoder.count, err, codec)
 			continue
 		}
 
-		fmt.Fprintf(output, "# Object %d\n", decoder.count)
-		fmt.Fprintln(output, string(jsonData))
+		if filter.Done() {
+			break
+		}
+	}
+
+	if finisher, ok := encoder.(StreamFinisher); ok {
+		if err := finisher.Finish(output); err != nil {
+			fmt.Fprintf(os.Stderr, "Error finishing output: %v\n", err)
+		}
 	}
 
-	fmt.Printf("Successfully processed %d JSON objects\n", decoder.count)
+	fmt.Fprintf(os.Stderr, "Successfully processed %d JSON objects\n", decoder.count)
 }
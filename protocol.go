@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/prometheus/prometheus/prompb"
+	writev2 "github.com/prometheus/prometheus/prompb/io/prometheus/write/v2"
+)
+
+// ProtocolVersion identifies which Remote Write wire format a record uses.
+type ProtocolVersion int
+
+const (
+	// ProtocolVersionAuto detects the protocol version per-record.
+	ProtocolVersionAuto ProtocolVersion = iota
+	// ProtocolVersionV1 is the prompb.WriteRequest format (Remote Write 1.0).
+	ProtocolVersionV1
+	// ProtocolVersionV2 is the prometheus.write.v2.Request format (Remote Write 2.0).
+	ProtocolVersionV2
+)
+
+// parseProtocolVersion parses the --protocol-version flag value.
+func parseProtocolVersion(s string) (ProtocolVersion, error) {
+	switch s {
+	case "", "auto":
+		return ProtocolVersionAuto, nil
+	case "v1":
+		return ProtocolVersionV1, nil
+	case "v2":
+		return ProtocolVersionV2, nil
+	default:
+		return ProtocolVersionAuto, fmt.Errorf("unknown protocol version %q (want auto, v1, or v2)", s)
+	}
+}
+
+// Histogram is a readable representation of a Prometheus native histogram,
+// decoded from either prompb.Histogram or writev2.Histogram.
+type Histogram struct {
+	IsFloat          bool      `json:"is_float"`
+	Count            float64   `json:"count"`
+	Sum              float64   `json:"sum"`
+	Schema           int32     `json:"schema"`
+	ZeroThreshold    float64   `json:"zero_threshold"`
+	ZeroCount        float64   `json:"zero_count"`
+	PositiveSpans    []Span    `json:"positive_spans,omitempty"`
+	PositiveDeltas   []int64   `json:"positive_deltas,omitempty"`
+	PositiveCounts   []float64 `json:"positive_counts,omitempty"`
+	NegativeSpans    []Span    `json:"negative_spans,omitempty"`
+	NegativeDeltas   []int64   `json:"negative_deltas,omitempty"`
+	NegativeCounts   []float64 `json:"negative_counts,omitempty"`
+	CounterResetHint string    `json:"counter_reset_hint"`
+	Timestamp        int64     `json:"timestamp"`
+
+	// PositiveBucketCounts and NegativeBucketCounts hold the reconstructed
+	// absolute per-bucket counts when decoded with --decode-histograms=cumulative.
+	PositiveBucketCounts []float64 `json:"positive_bucket_counts,omitempty"`
+	NegativeBucketCounts []float64 `json:"negative_bucket_counts,omitempty"`
+}
+
+// Span is a readable representation of prompb's bucket span encoding.
+type Span struct {
+	Offset int32  `json:"offset"`
+	Length uint32 `json:"length"`
+}
+
+// Exemplar is a readable representation of a prompb/writev2 exemplar.
+type Exemplar struct {
+	Labels    map[string]string `json:"labels"`
+	Value     float64           `json:"value"`
+	Timestamp int64             `json:"timestamp"`
+}
+
+// Metadata is the per-series metadata carried alongside PRW 2.0 time series.
+type Metadata struct {
+	Type string `json:"type"`
+	Help string `json:"help,omitempty"`
+	Unit string `json:"unit,omitempty"`
+}
+
+// decodeWriteRequest decompresses and unmarshals a PrometheusRecord into a
+// WriteRequestJSON, autodetecting or honoring the requested protocol version.
+// It returns the name of the compression codec that was used, for diagnostics.
+func decodeWriteRequest(record *PrometheusRecord, version ProtocolVersion, decomp Decompressor, mode HistogramDecodeMode) (*WriteRequestJSON, string, error) {
+	codec, data, err := decompressNamed(decomp, record.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("decompress error: %w", err)
+	}
+
+	var result *WriteRequestJSON
+	switch version {
+	case ProtocolVersionV1:
+		result, err = decodeV1(data, mode)
+	case ProtocolVersionV2:
+		result, err = decodeV2(data, mode)
+	default:
+		if looksLikeV2(data) {
+			if v2Result, v2Err := decodeV2(data, mode); v2Err == nil {
+				return v2Result, codec, nil
+			}
+		}
+		result, err = decodeV1(data, mode)
+	}
+	return result, codec, err
+}
+
+// codecSniffer is implemented by decompressors that determine the codec
+// per record (e.g. auto-detection) and can report which one was chosen.
+type codecSniffer interface {
+	decompressSniffed(data []byte) (codec string, out []byte, err error)
+}
+
+func decompressNamed(decomp Decompressor, data []byte) (codec string, out []byte, err error) {
+	if sniffer, ok := decomp.(codecSniffer); ok {
+		return sniffer.decompressSniffed(data)
+	}
+	out, err = decomp.Decompress(data)
+	return decomp.Name(), out, err
+}
+
+// looksLikeV2 peeks at the unmarshaled message to see whether it honors the
+// PRW 2.0 invariant that Symbols[0] is always the empty string sentinel.
+func looksLikeV2(data []byte) bool {
+	var req writev2.Request
+	if err := proto.Unmarshal(data, &req); err != nil {
+		return false
+	}
+	return len(req.Symbols) > 0 && req.Symbols[0] == ""
+}
+
+// decodeRawV1 decompresses and unmarshals a record as a prompb.WriteRequest
+// without converting it to the readable JSON struct, for callers that can
+// marshal directly from the protobuf (see marshalWriteRequestFast).
+func decodeRawV1(record *PrometheusRecord, decomp Decompressor) (*prompb.WriteRequest, string, error) {
+	codec, data, err := decompressNamed(decomp, record.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("decompress error: %w", err)
+	}
+
+	var req prompb.WriteRequest
+	if err := proto.Unmarshal(data, &req); err != nil {
+		return nil, "", fmt.Errorf("protobuf unmarshal error (v1): %w", err)
+	}
+	return &req, codec, nil
+}
+
+func decodeV1(data []byte, mode HistogramDecodeMode) (*WriteRequestJSON, error) {
+	var req prompb.WriteRequest
+	if err := proto.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("protobuf unmarshal error (v1): %w", err)
+	}
+	return convertToReadableJSON(&req, mode), nil
+}
+
+func decodeV2(data []byte, mode HistogramDecodeMode) (*WriteRequestJSON, error) {
+	var req writev2.Request
+	if err := proto.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("protobuf unmarshal error (v2): %w", err)
+	}
+	return convertWriteV2ToReadableJSON(&req, mode), nil
+}
+
+// convertWriteV2ToReadableJSON resolves the symbol-table-backed label refs in
+// a PRW 2.0 request into the same TimeSeries shape used for v1.
+func convertWriteV2ToReadableJSON(req *writev2.Request, mode HistogramDecodeMode) *WriteRequestJSON {
+	symbols := req.Symbols
+	result := &WriteRequestJSON{
+		Timeseries: make([]TimeSeries, len(req.Timeseries)),
+	}
+
+	for i, ts := range req.Timeseries {
+		labels := make(map[string]string, len(ts.LabelsRefs)/2)
+		for j := 0; j+1 < len(ts.LabelsRefs); j += 2 {
+			name := symbolAt(symbols, ts.LabelsRefs[j])
+			value := symbolAt(symbols, ts.LabelsRefs[j+1])
+			labels[name] = value
+		}
+
+		timestamps := make([]int64, len(ts.Samples))
+		values := make([]float64, len(ts.Samples))
+		for j, sample := range ts.Samples {
+			timestamps[j] = sample.Timestamp
+			values[j] = sample.Value
+		}
+
+		exemplars := make([]Exemplar, len(ts.Exemplars))
+		for j, ex := range ts.Exemplars {
+			exLabels := make(map[string]string, len(ex.LabelsRefs)/2)
+			for k := 0; k+1 < len(ex.LabelsRefs); k += 2 {
+				name := symbolAt(symbols, ex.LabelsRefs[k])
+				value := symbolAt(symbols, ex.LabelsRefs[k+1])
+				exLabels[name] = value
+			}
+			exemplars[j] = Exemplar{
+				Labels:    exLabels,
+				Value:     ex.Value,
+				Timestamp: ex.Timestamp,
+			}
+		}
+
+		histograms := make([]Histogram, len(ts.Histograms))
+		for j, h := range ts.Histograms {
+			histograms[j] = convertWriteV2Histogram(h)
+			applyHistogramDecodeMode(&histograms[j], mode)
+		}
+
+		var metadata *Metadata
+		if ts.Metadata.Type != writev2.Metadata_METRIC_TYPE_UNSPECIFIED || ts.Metadata.HelpRef != 0 || ts.Metadata.UnitRef != 0 {
+			metadata = &Metadata{
+				Type: ts.Metadata.Type.String(),
+				Help: symbolAt(symbols, ts.Metadata.HelpRef),
+				Unit: symbolAt(symbols, ts.Metadata.UnitRef),
+			}
+		}
+
+		result.Timeseries[i] = TimeSeries{
+			Labels:           labels,
+			Timestamps:       timestamps,
+			Values:           values,
+			Exemplars:        exemplars,
+			Histograms:       histograms,
+			Metadata:         metadata,
+			CreatedTimestamp: ts.CreatedTimestamp,
+		}
+	}
+
+	return result
+}
+
+func symbolAt(symbols []string, ref uint32) string {
+	if int(ref) >= len(symbols) {
+		return ""
+	}
+	return symbols[ref]
+}
+
+func convertWriteV2Histogram(h writev2.Histogram) Histogram {
+	_, isFloat := h.GetCount().(*writev2.Histogram_CountFloat)
+
+	out := Histogram{
+		IsFloat:          isFloat,
+		Schema:           h.Schema,
+		ZeroThreshold:    h.ZeroThreshold,
+		CounterResetHint: h.ResetHint.String(),
+		Timestamp:        h.Timestamp,
+	}
+
+	if isFloat {
+		out.Count = h.GetCountFloat()
+		out.ZeroCount = h.GetZeroCountFloat()
+	} else {
+		out.Count = float64(h.GetCountInt())
+		out.ZeroCount = float64(h.GetZeroCountInt())
+	}
+	out.Sum = h.Sum
+
+	out.PositiveSpans = convertWriteV2Spans(h.PositiveSpans)
+	out.NegativeSpans = convertWriteV2Spans(h.NegativeSpans)
+	out.PositiveDeltas = h.PositiveDeltas
+	out.NegativeDeltas = h.NegativeDeltas
+	out.PositiveCounts = h.PositiveCounts
+	out.NegativeCounts = h.NegativeCounts
+
+	return out
+}
+
+func convertWriteV2Spans(spans []writev2.BucketSpan) []Span {
+	if len(spans) == 0 {
+		return nil
+	}
+	out := make([]Span, len(spans))
+	for i, s := range spans {
+		out[i] = Span{Offset: s.Offset, Length: s.Length}
+	}
+	return out
+}
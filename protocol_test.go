@@ -0,0 +1,145 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	writev2 "github.com/prometheus/prometheus/prompb/io/prometheus/write/v2"
+)
+
+// snappyRecord snappy-encodes a protobuf message into a PrometheusRecord, the
+// way a real remote-write client would.
+func snappyRecord(t *testing.T, msg proto.Message) *PrometheusRecord {
+	t.Helper()
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return &PrometheusRecord{Body: snappy.Encode(nil, data)}
+}
+
+// TestDecodeWriteRequestMixedBatch decodes a batch with some records in v1
+// and others in v2, as a real multi-client stream might send, and checks
+// protocol auto-detection picks the right decoder for each.
+func TestDecodeWriteRequestMixedBatch(t *testing.T) {
+	v1Record := snappyRecord(t, &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "v1_metric"}, {Name: "job", Value: "a"}},
+			Samples: []prompb.Sample{{Value: 1.5, Timestamp: 1000}},
+		}},
+	})
+	v2Record := snappyRecord(t, &writev2.Request{
+		Symbols: []string{"", "__name__", "v2_metric", "job", "b"},
+		Timeseries: []writev2.TimeSeries{{
+			LabelsRefs: []uint32{1, 2, 3, 4},
+			Samples:    []writev2.Sample{{Value: 2.5, Timestamp: 2000}},
+		}},
+	})
+
+	decomp := snappyDecompressor{}
+
+	v1Result, v1Codec, err := decodeWriteRequest(v1Record, ProtocolVersionAuto, decomp, HistogramDecodeRaw)
+	if err != nil {
+		t.Fatalf("decode v1 record: %v", err)
+	}
+	if v1Codec != "snappy" {
+		t.Errorf("codec = %q, want snappy", v1Codec)
+	}
+	if got := v1Result.Timeseries[0].Labels["__name__"]; got != "v1_metric" {
+		t.Errorf("v1 __name__ = %q, want v1_metric", got)
+	}
+	if got := v1Result.Timeseries[0].Values[0]; got != 1.5 {
+		t.Errorf("v1 value = %v, want 1.5", got)
+	}
+
+	v2Result, v2Codec, err := decodeWriteRequest(v2Record, ProtocolVersionAuto, decomp, HistogramDecodeRaw)
+	if err != nil {
+		t.Fatalf("decode v2 record: %v", err)
+	}
+	if v2Codec != "snappy" {
+		t.Errorf("codec = %q, want snappy", v2Codec)
+	}
+	if got := v2Result.Timeseries[0].Labels["__name__"]; got != "v2_metric" {
+		t.Errorf("v2 __name__ = %q, want v2_metric", got)
+	}
+	if got := v2Result.Timeseries[0].Values[0]; got != 2.5 {
+		t.Errorf("v2 value = %v, want 2.5", got)
+	}
+}
+
+// TestDecodeWriteRequestHistogramOnlyPayload decodes a series carrying only
+// a native histogram and no float samples, which previously risked being
+// misread if histogram float/int detection was wrong.
+func TestDecodeWriteRequestHistogramOnlyPayload(t *testing.T) {
+	record := snappyRecord(t, &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{{
+			Labels: []prompb.Label{{Name: "__name__", Value: "histogram_metric"}},
+			Histograms: []prompb.Histogram{{
+				Count:          &prompb.Histogram_CountInt{CountInt: 10},
+				ZeroCount:      &prompb.Histogram_ZeroCountInt{ZeroCountInt: 2},
+				Sum:            5.5,
+				Schema:         0,
+				ZeroThreshold:  0.001,
+				PositiveSpans:  []prompb.BucketSpan{{Offset: 0, Length: 2}},
+				PositiveDeltas: []int64{1, 1},
+				Timestamp:      1000,
+			}},
+		}},
+	})
+
+	result, _, err := decodeWriteRequest(record, ProtocolVersionV1, snappyDecompressor{}, HistogramDecodeRaw)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(result.Timeseries) != 1 {
+		t.Fatalf("got %d timeseries, want 1", len(result.Timeseries))
+	}
+
+	ts := result.Timeseries[0]
+	if len(ts.Values) != 0 || len(ts.Timestamps) != 0 {
+		t.Errorf("got %d float samples, want 0 for a histogram-only series", len(ts.Values))
+	}
+	if len(ts.Histograms) != 1 {
+		t.Fatalf("got %d histograms, want 1", len(ts.Histograms))
+	}
+
+	h := ts.Histograms[0]
+	if h.IsFloat {
+		t.Errorf("IsFloat = true, want false for an integer-encoded histogram")
+	}
+	if h.Count != 10 {
+		t.Errorf("Count = %v, want 10", h.Count)
+	}
+	if h.ZeroCount != 2 {
+		t.Errorf("ZeroCount = %v, want 2", h.ZeroCount)
+	}
+}
+
+// TestDecodeWriteRequestFloatHistogramZeroCount exercises the regression this
+// heuristic is sensitive to: a valid float histogram whose count happens to
+// be 0.0 with no populated buckets must still be reported as a float
+// histogram, not misread as an empty integer one.
+func TestDecodeWriteRequestFloatHistogramZeroCount(t *testing.T) {
+	record := snappyRecord(t, &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{{
+			Labels: []prompb.Label{{Name: "__name__", Value: "empty_float_histogram"}},
+			Histograms: []prompb.Histogram{{
+				Count:     &prompb.Histogram_CountFloat{CountFloat: 0},
+				ZeroCount: &prompb.Histogram_ZeroCountFloat{ZeroCountFloat: 0},
+				Timestamp: 1000,
+			}},
+		}},
+	})
+
+	result, _, err := decodeWriteRequest(record, ProtocolVersionV1, snappyDecompressor{}, HistogramDecodeRaw)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	h := result.Timeseries[0].Histograms[0]
+	if !h.IsFloat {
+		t.Errorf("IsFloat = false, want true for an empty float histogram")
+	}
+}
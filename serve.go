@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// serverMetrics tracks basic self-observability counters for the serve subcommand.
+type serverMetrics struct {
+	recordsDecoded int64
+	decodeErrors   int64
+	bytesIn        int64
+}
+
+func (m *serverMetrics) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP prometheus_decoder_records_decoded_total Number of remote-write requests successfully decoded.\n")
+	fmt.Fprintf(w, "# TYPE prometheus_decoder_records_decoded_total counter\n")
+	fmt.Fprintf(w, "prometheus_decoder_records_decoded_total %d\n", atomic.LoadInt64(&m.recordsDecoded))
+	fmt.Fprintf(w, "# HELP prometheus_decoder_decode_errors_total Number of remote-write requests that failed to decode.\n")
+	fmt.Fprintf(w, "# TYPE prometheus_decoder_decode_errors_total counter\n")
+	fmt.Fprintf(w, "prometheus_decoder_decode_errors_total %d\n", atomic.LoadInt64(&m.decodeErrors))
+	fmt.Fprintf(w, "# HELP prometheus_decoder_bytes_in_total Bytes of request body received.\n")
+	fmt.Fprintf(w, "# TYPE prometheus_decoder_bytes_in_total counter\n")
+	fmt.Fprintf(w, "prometheus_decoder_bytes_in_total %d\n", atomic.LoadInt64(&m.bytesIn))
+}
+
+// sink writes one decoded JSON record to its destination.
+type sink interface {
+	Write(data []byte) error
+}
+
+// writerSink writes newline-delimited JSON to an io.Writer (stdout or a
+// file). The serve subcommand handles requests concurrently, so writes are
+// serialized to keep records from interleaving.
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *writerSink) Write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(append(data, '\n'))
+	return err
+}
+
+// webhookSink POSTs each decoded record to a configured URL.
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookSink(url string) *webhookSink {
+	return &webhookSink{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *webhookSink) Write(data []byte) error {
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("webhook post error: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// newSink constructs the sink named by the --sink flag.
+func newSink(kind, target string) (sink, error) {
+	switch kind {
+	case "", "stdout":
+		return &writerSink{w: os.Stdout}, nil
+	case "file":
+		if target == "" {
+			return nil, fmt.Errorf("--sink-target is required for --sink=file")
+		}
+		f, err := os.Create(target)
+		if err != nil {
+			return nil, fmt.Errorf("opening sink file: %w", err)
+		}
+		return &writerSink{w: f}, nil
+	case "webhook":
+		if target == "" {
+			return nil, fmt.Errorf("--sink-target is required for --sink=webhook")
+		}
+		return newWebhookSink(target), nil
+	default:
+		return nil, fmt.Errorf("unknown sink %q (want stdout, file, or webhook)", kind)
+	}
+}
+
+// writeServer implements the Prometheus remote_write HTTP receiver, decoding
+// incoming bodies with the same pipeline used for file input and streaming
+// the readable JSON to a sink.
+type writeServer struct {
+	decomp        Decompressor
+	sink          sink
+	pretty        bool
+	histogramMode HistogramDecodeMode
+	metrics       *serverMetrics
+}
+
+// handleWrite builds the handler for one of the two remote-write endpoints,
+// defaultVersion being the protocol version implied by the endpoint path
+// unless the client overrides it with X-Prometheus-Remote-Write-Version.
+func (s *writeServer) handleWrite(defaultVersion ProtocolVersion) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("reading body: %v", err), http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt64(&s.metrics.bytesIn, int64(len(body)))
+
+		version := defaultVersion
+		if hdr := r.Header.Get("X-Prometheus-Remote-Write-Version"); hdr != "" {
+			version = remoteWriteVersionFromHeader(hdr)
+		}
+
+		jsonStruct, _, err := decodeWriteRequest(&PrometheusRecord{Body: body}, version, s.decomp, s.histogramMode)
+		if err != nil {
+			atomic.AddInt64(&s.metrics.decodeErrors, 1)
+			http.Error(w, fmt.Sprintf("decode error: %v", err), http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt64(&s.metrics.recordsDecoded, 1)
+
+		var jsonData []byte
+		if s.pretty {
+			jsonData, err = jsonAPI.MarshalIndent(jsonStruct, "", "  ")
+		} else {
+			jsonData, err = jsonAPI.Marshal(jsonStruct)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("encode error: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if err := s.sink.Write(jsonData); err != nil {
+			http.Error(w, fmt.Sprintf("sink error: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		if version == ProtocolVersionV2 {
+			samples, histograms, exemplars := countWritten(jsonStruct)
+			w.Header().Set("X-Prometheus-Remote-Write-Samples-Written", strconv.Itoa(samples))
+			w.Header().Set("X-Prometheus-Remote-Write-Histograms-Written", strconv.Itoa(histograms))
+			w.Header().Set("X-Prometheus-Remote-Write-Exemplars-Written", strconv.Itoa(exemplars))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func countWritten(wreq *WriteRequestJSON) (samples, histograms, exemplars int) {
+	for _, ts := range wreq.Timeseries {
+		samples += len(ts.Timestamps)
+		histograms += len(ts.Histograms)
+		exemplars += len(ts.Exemplars)
+	}
+	return
+}
+
+// remoteWriteVersionFromHeader maps an X-Prometheus-Remote-Write-Version
+// header value (e.g. "2.0", "0.1.0") to a ProtocolVersion.
+func remoteWriteVersionFromHeader(header string) ProtocolVersion {
+	if strings.HasPrefix(header, "2") {
+		return ProtocolVersionV2
+	}
+	return ProtocolVersionV1
+}
+
+// runServe starts the HTTP remote-write receiver subcommand: `prometheus-decoder serve [flags]`.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":9201", "Address to listen on")
+	compressionFlag := fs.String("compression", "auto", "Compression codec to decode: auto, snappy, zstd, gzip, or none")
+	prettyPrint := fs.Bool("pretty", false, "Enable pretty-printing of JSON output")
+	sinkKind := fs.String("sink", "stdout", "Where to stream decoded JSON: stdout, file, or webhook")
+	sinkTarget := fs.String("sink-target", "", "File path (for --sink=file) or URL (for --sink=webhook)")
+	decodeHistogramsFlag := fs.String("decode-histograms", "raw", "Native histogram bucket rendering: raw or cumulative")
+	fs.Parse(args)
+
+	decomp, err := newDecompressor(*compressionFlag)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	histogramMode, err := parseHistogramDecodeMode(*decodeHistogramsFlag)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	sinkImpl, err := newSink(*sinkKind, *sinkTarget)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	server := &writeServer{
+		decomp:        decomp,
+		sink:          sinkImpl,
+		pretty:        *prettyPrint,
+		histogramMode: histogramMode,
+		metrics:       &serverMetrics{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/write", server.handleWrite(ProtocolVersionV1))
+	mux.HandleFunc("/api/v2/write", server.handleWrite(ProtocolVersionV2))
+	mux.HandleFunc("/metrics", server.metrics.handleMetrics)
+
+	fmt.Printf("Listening on %s (sink=%s)\n", *addr, *sinkKind)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}